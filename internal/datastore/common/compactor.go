@@ -0,0 +1,161 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	log "github.com/authzed/spicedb/internal/logging"
+	"github.com/authzed/spicedb/pkg/datastore"
+)
+
+// Compactor is implemented by datastores that support being driven by the
+// standalone `spicedb compactor` service. It extends GarbageCollector with
+// the deeper compaction passes the in-process embedded GC skips, plus
+// leader election so that only one of several compactor replicas performs
+// work at a time. The existing embedded GC loop (StartGarbageCollector)
+// only ever needs the GarbageCollector half of this interface, so it
+// remains a thin client of whatever a Compactor-capable datastore exposes.
+type Compactor interface {
+	GarbageCollector
+
+	// Compact performs the deeper passes a plain GC pass skips: merging
+	// historical tuple rows into snapshot rows, vacuuming aliased
+	// permissions whose targets have been deleted, and rebuilding
+	// transaction-indexed indexes when bloat exceeds a threshold.
+	Compact(ctx context.Context) error
+
+	// AcquireCompactorLease attempts to take or renew the named lease for
+	// ttl, using the datastore itself as the lock (e.g. a row in a
+	// compactor_leases table). It returns true if this process holds the
+	// lease after the call.
+	AcquireCompactorLease(ctx context.Context, name string, ttl time.Duration) (bool, error)
+
+	// ReleaseCompactorLease releases a lease previously acquired via
+	// AcquireCompactorLease.
+	ReleaseCompactorLease(ctx context.Context, name string) error
+}
+
+// CompactorLeaseName is the name of the lease compactor replicas contend
+// for so that only one of them runs GC and compaction passes at a time.
+const CompactorLeaseName = "compactor"
+
+// CompactorConfig controls the standalone compactor service's run loop.
+type CompactorConfig struct {
+	// Interval is the time between compaction passes.
+	Interval time.Duration
+
+	// Window is the GC window, resolved the same way as the embedded GC's.
+	Window time.Duration
+
+	// Timeout bounds a single GC+compaction pass.
+	Timeout time.Duration
+
+	// LeaseTTL is how long a held lease remains valid without renewal.
+	LeaseTTL time.Duration
+
+	// MetricsAddr, if non-empty, is the address for a dedicated HTTP
+	// listener exposing /metrics, /healthz, and /debug/pprof.
+	MetricsAddr string
+}
+
+// RunCompactor runs GC and deep compaction passes against c on cfg.Interval,
+// only performing work while this process holds the CompactorLeaseName
+// lease, until ctx is cancelled.
+func RunCompactor(ctx context.Context, c Compactor, cfg CompactorConfig) error {
+	if cfg.MetricsAddr != "" {
+		srv := newCompactorHTTPServer(cfg.MetricsAddr, c)
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Ctx(ctx).Error().Err(err).Msg("compactor metrics server failed")
+			}
+		}()
+		defer srv.Close()
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = c.ReleaseCompactorLease(context.Background(), CompactorLeaseName)
+			return ctx.Err()
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+			err := runCompactionPass(runCtx, c, cfg)
+			cancel()
+			if err != nil {
+				log.Ctx(ctx).Warn().Err(err).Msg("compaction pass failed")
+			}
+		}
+	}
+}
+
+func runCompactionPass(ctx context.Context, c Compactor, cfg CompactorConfig) error {
+	isLeader, err := c.AcquireCompactorLease(ctx, CompactorLeaseName, cfg.LeaseTTL)
+	if err != nil {
+		return err
+	}
+	if !isLeader {
+		log.Ctx(ctx).Debug().Msg("compactor lease held by another replica, skipping pass")
+		return nil
+	}
+
+	if _, _, err := RunGCPass(ctx, c, cfg.Window); err != nil {
+		return err
+	}
+
+	return c.Compact(ctx)
+}
+
+// RunGCPass runs a single GC pass against gc: resolving window into a
+// revision via Now/TxIDBefore, deleting everything before it, and marking
+// the pass complete. This is the same sequence the embedded GC loop
+// (StartGarbageCollector) runs on every tick and the one-shot `datastore
+// gc` command runs once; it is factored out here so none of gc's callers
+// drift apart from each other by reimplementing it inline.
+func RunGCPass(ctx context.Context, gc GarbageCollector, window time.Duration) (datastore.Revision, DeletionCounts, error) {
+	now, err := gc.Now(ctx)
+	if err != nil {
+		return nil, DeletionCounts{}, err
+	}
+
+	before, err := gc.TxIDBefore(ctx, now.Add(-window))
+	if err != nil {
+		return nil, DeletionCounts{}, err
+	}
+
+	counts, err := gc.DeleteBeforeTx(ctx, before)
+	if err != nil {
+		return before, DeletionCounts{}, err
+	}
+	gc.MarkGCCompleted()
+
+	return before, counts, nil
+}
+
+// newCompactorHTTPServer builds the compactor's dedicated listener, kept
+// separate from the main serve command's API listeners so operators can
+// scrape GC/compaction state without touching the query API.
+func newCompactorHTTPServer(addr string, c Compactor) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		state, err := c.ReadyState(r.Context())
+		if err != nil || !state.IsReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return &http.Server{Addr: addr, Handler: mux}
+}
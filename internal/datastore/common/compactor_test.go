@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCompactor embeds fakeGC to satisfy Compactor, tracking whether it was
+// granted the lease and how many times Compact ran.
+type fakeCompactor struct {
+	fakeGC
+
+	isLeader     bool
+	compactCalls int
+}
+
+func newFakeCompactor(isLeader bool) *fakeCompactor {
+	gc := newFakeGC(revisionErrorDeleter{})
+	return &fakeCompactor{fakeGC: gc, isLeader: isLeader}
+}
+
+func (c *fakeCompactor) Compact(_ context.Context) error {
+	c.compactCalls++
+	return nil
+}
+
+func (c *fakeCompactor) AcquireCompactorLease(_ context.Context, _ string, _ time.Duration) (bool, error) {
+	return c.isLeader, nil
+}
+
+func (c *fakeCompactor) ReleaseCompactorLease(_ context.Context, _ string) error {
+	return nil
+}
+
+func TestRunCompactionPass_SkipsWhenNotLeader(t *testing.T) {
+	c := newFakeCompactor(false)
+
+	require.NoError(t, runCompactionPass(context.Background(), c, CompactorConfig{Window: time.Hour}))
+	require.Zero(t, c.compactCalls)
+	require.False(t, c.HasGCRun())
+}
+
+func TestRunCompactionPass_RunsGCThenCompactWhenLeader(t *testing.T) {
+	c := newFakeCompactor(true)
+
+	require.NoError(t, runCompactionPass(context.Background(), c, CompactorConfig{Window: time.Hour}))
+	require.Equal(t, 1, c.compactCalls)
+	require.True(t, c.HasGCRun())
+}
+
+func TestRunGCPass_MarksCompletedOnSuccess(t *testing.T) {
+	gc := newFakeGC(revisionErrorDeleter{})
+
+	_, counts, err := RunGCPass(context.Background(), &gc, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, DeletionCounts{}, counts)
+	require.True(t, gc.HasGCRun())
+}
+
+func TestRunGCPass_DoesNotMarkCompletedOnError(t *testing.T) {
+	gc := newFakeGC(alwaysErrorDeleter{})
+
+	_, _, err := RunGCPass(context.Background(), &gc, time.Hour)
+	require.Error(t, err)
+	require.False(t, gc.HasGCRun())
+}
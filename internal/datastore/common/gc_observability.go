@@ -0,0 +1,151 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// gcMetricsGracePeriod is how long the one-shot `datastore gc` command's
+// metrics server stays up after a pass completes, giving batch jobs and
+// cron systems a chance to scrape the final snapshot before the process
+// exits.
+const gcMetricsGracePeriod = 5 * time.Second
+
+// GCMetrics holds the Prometheus collectors reported by the standalone
+// `datastore gc` command's --metrics-addr server. They are kept in their
+// own registry rather than the global one, since a one-shot job only ever
+// reports a single pass.
+type GCMetrics struct {
+	registry             *prometheus.Registry
+	relationshipsDeleted prometheus.Counter
+	namespacesDeleted    prometheus.Counter
+	transactionsDeleted  prometheus.Counter
+	duration             prometheus.Histogram
+}
+
+// NewGCMetrics constructs a fresh GCMetrics with its own registry.
+func NewGCMetrics() *GCMetrics {
+	m := &GCMetrics{
+		registry: prometheus.NewRegistry(),
+		relationshipsDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "spicedb",
+			Subsystem: "datastore",
+			Name:      "gc_relationships_deleted_total",
+			Help:      "Number of relationships deleted by this garbage collection run.",
+		}),
+		namespacesDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "spicedb",
+			Subsystem: "datastore",
+			Name:      "gc_namespaces_deleted_total",
+			Help:      "Number of namespaces deleted by this garbage collection run.",
+		}),
+		transactionsDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "spicedb",
+			Subsystem: "datastore",
+			Name:      "gc_transactions_deleted_total",
+			Help:      "Number of transactions deleted by this garbage collection run.",
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "spicedb",
+			Subsystem: "datastore",
+			Name:      "gc_duration_seconds",
+			Help:      "Wall-clock duration of this garbage collection run.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+
+	m.registry.MustRegister(m.relationshipsDeleted, m.namespacesDeleted, m.transactionsDeleted, m.duration)
+	return m
+}
+
+// Record reports the result of a single DeleteBeforeTx call.
+func (m *GCMetrics) Record(counts DeletionCounts, duration time.Duration) {
+	m.relationshipsDeleted.Add(float64(counts.Relationships))
+	m.namespacesDeleted.Add(float64(counts.Namespaces))
+	m.transactionsDeleted.Add(float64(counts.Transactions))
+	m.duration.Observe(duration.Seconds())
+}
+
+// ServeAndHold starts a short-lived HTTP server exposing m on addr, blocking
+// until ctx is cancelled or gcMetricsGracePeriod elapses, whichever comes
+// first, then shuts the server down. Callers should start this after
+// recording a completed GC pass so a scraper has a final snapshot to read.
+func (m *GCMetrics) ServeAndHold(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil && err != http.ErrServerClosed {
+			return err
+		}
+	case <-time.After(gcMetricsGracePeriod):
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// GCActionLogEntry is a single record appended to a `datastore gc
+// --action-log` file, describing one DeleteBeforeTx invocation.
+type GCActionLogEntry struct {
+	TargetRevision string         `json:"target_revision"`
+	Counts         DeletionCounts `json:"counts"`
+	Duration       time.Duration  `json:"duration"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// AppendGCActionLog appends entry to the JSON-lines action log at path,
+// writing the new content to a temp file and renaming it over the original
+// so the log is never left partially written if the process is killed
+// mid-append.
+func AppendGCActionLog(path string, entry GCActionLogEntry) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read action log: %w", err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal action log entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create action log temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(existing); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to write action log temp file: %w", err)
+	}
+	if _, err := tmp.Write(append(line, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to write action log temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to close action log temp file: %w", err)
+	}
+
+	return os.Rename(tmpName, path)
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendGCActionLog_AppendsOneLinePerCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "action-log.jsonl")
+
+	require.NoError(t, AppendGCActionLog(path, GCActionLogEntry{
+		TargetRevision: "1",
+		Counts:         DeletionCounts{Relationships: 10},
+		Duration:       time.Second,
+	}))
+	require.NoError(t, AppendGCActionLog(path, GCActionLogEntry{
+		TargetRevision: "2",
+		Counts:         DeletionCounts{Relationships: 5},
+		Duration:       2 * time.Second,
+		Error:          "boom",
+	}))
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var entries []GCActionLogEntry
+	for _, line := range splitNonEmptyLines(contents) {
+		var entry GCActionLogEntry
+		require.NoError(t, json.Unmarshal(line, &entry))
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 2)
+	require.Equal(t, "1", entries[0].TargetRevision)
+	require.Equal(t, "2", entries[1].TargetRevision)
+	require.Equal(t, "boom", entries[1].Error)
+}
+
+func splitNonEmptyLines(data []byte) [][]byte {
+	var lines [][]byte
+	start := 0
+	for i, b := range data {
+		if b == '\n' {
+			if i > start {
+				lines = append(lines, data[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(data) {
+		lines = append(lines, data[start:])
+	}
+	return lines
+}
+
+func TestGCMetricsRecord(t *testing.T) {
+	m := NewGCMetrics()
+	m.Record(DeletionCounts{Relationships: 3, Namespaces: 1, Transactions: 2}, 500*time.Millisecond)
+
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+
+	var sawRelationships, sawDuration bool
+	for _, family := range families {
+		switch family.GetName() {
+		case "spicedb_datastore_gc_relationships_deleted_total":
+			require.Equal(t, float64(3), family.GetMetric()[0].GetCounter().GetValue())
+			sawRelationships = true
+		case "spicedb_datastore_gc_duration_seconds":
+			require.Equal(t, uint64(1), family.GetMetric()[0].GetHistogram().GetSampleCount())
+			sawDuration = true
+		}
+	}
+
+	require.True(t, sawRelationships, "expected relationships-deleted counter to be registered")
+	require.True(t, sawDuration, "expected duration histogram to be registered")
+}
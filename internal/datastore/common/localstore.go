@@ -0,0 +1,34 @@
+package common
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalObjectStore is an ObjectStore backed by a directory on the local
+// filesystem. It is the only store implemented by `datastore backup` and
+// `datastore restore` today; the ObjectStore interface is narrow enough
+// that an S3- or GCS-backed store could implement it, but no such store
+// exists yet and the CLI does not support selecting one.
+type LocalObjectStore struct {
+	dir string
+}
+
+// NewLocalObjectStore returns an ObjectStore rooted at dir, creating it if
+// it does not already exist.
+func NewLocalObjectStore(dir string) (*LocalObjectStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalObjectStore{dir: dir}, nil
+}
+
+func (s *LocalObjectStore) Create(_ context.Context, name string) (io.WriteCloser, error) {
+	return os.Create(filepath.Join(s.dir, name))
+}
+
+func (s *LocalObjectStore) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, name))
+}
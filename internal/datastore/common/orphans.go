@@ -0,0 +1,157 @@
+package common
+
+import (
+	"context"
+
+	"github.com/authzed/spicedb/internal/namespace"
+	"github.com/authzed/spicedb/pkg/datastore"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+// OrphanedRelationshipsRepairOperationName is the RepairOperation name for
+// deleting the tuples surfaced by an OrphanScanner. No datastore engine
+// registers a RepairOperation under this name, so `datastore repair` does
+// not offer it; `datastore list-orphaned --repair` deletes through
+// DeleteOrphanedRelationshipsBatch directly.
+const OrphanedRelationshipsRepairOperationName = "orphaned-relationships"
+
+// OrphanedRelationship is a relation tuple whose resource type, resource
+// relation, subject type, or subject relation is no longer defined by the
+// current schema.
+type OrphanedRelationship struct {
+	Resource tuple.ObjectAndRelation
+	Subject  tuple.ObjectAndRelation
+	Reason   namespace.OrphanReason
+}
+
+// OrphanScannerConfig filters and bounds an OrphanScanner.Scan call.
+type OrphanScannerConfig struct {
+	// Namespace restricts the scan to a single resource type, if set.
+	Namespace string
+
+	// Limit stops the scan after this many orphaned tuples are found. Zero
+	// means unlimited.
+	Limit uint64
+}
+
+// ScanProgress is reported periodically during a scan so operators can
+// observe liveness on a full scan of a large datastore.
+type ScanProgress struct {
+	Scanned  uint64
+	Orphaned uint64
+}
+
+// OrphanScanner walks every live relation tuple visible to a reader and
+// reports the ones that no longer have a home in the current schema. It
+// streams tuples through the reader's QueryRelationships iterator, so a
+// scan over a large datastore does not hold the whole tuple set in memory.
+// A scan takes no cursor and cannot be resumed; each Scan call starts from
+// the beginning.
+type OrphanScanner struct {
+	reader datastore.Reader
+	index  *namespace.SchemaIndex
+}
+
+// NewOrphanScanner returns an OrphanScanner that checks tuples read from
+// reader against index.
+func NewOrphanScanner(reader datastore.Reader, index *namespace.SchemaIndex) *OrphanScanner {
+	return &OrphanScanner{reader: reader, index: index}
+}
+
+// Scan walks relation tuples matching cfg, invoking onOrphan for each
+// orphaned tuple found and onProgress roughly every 10,000 tuples scanned,
+// until the scan completes, cfg.Limit orphans have been found, or ctx is
+// cancelled.
+func (s *OrphanScanner) Scan(ctx context.Context, cfg OrphanScannerConfig, onOrphan func(OrphanedRelationship) error, onProgress func(ScanProgress)) error {
+	filter := datastore.RelationshipsFilter{OptionalResourceType: cfg.Namespace}
+
+	iter, err := s.reader.QueryRelationships(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	const progressInterval = 10_000
+
+	var progress ScanProgress
+	for tpl := iter.Next(); tpl != nil; tpl = iter.Next() {
+		progress.Scanned++
+
+		ok, reason := s.index.CheckRelationship(
+			tpl.ResourceAndRelation.Namespace,
+			tpl.ResourceAndRelation.Relation,
+			tpl.Subject.Namespace,
+			tpl.Subject.Relation,
+		)
+		if !ok {
+			progress.Orphaned++
+			if err := onOrphan(OrphanedRelationship{
+				Resource: *tpl.ResourceAndRelation,
+				Subject:  *tpl.Subject,
+				Reason:   reason,
+			}); err != nil {
+				return err
+			}
+
+			if cfg.Limit > 0 && progress.Orphaned >= cfg.Limit {
+				break
+			}
+		}
+
+		if onProgress != nil && progress.Scanned%progressInterval == 0 {
+			onProgress(progress)
+		}
+	}
+
+	// Next returns nil both on exhaustion and on a read error; the error
+	// must be checked after the loop exits, not only while it's running,
+	// or a mid-stream read error is silently treated as "scan complete".
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if onProgress != nil {
+		onProgress(progress)
+	}
+
+	return nil
+}
+
+// DeleteOrphanedRelationshipsBatch deletes the given orphans from ds in
+// bounded batches, all under a single revision, so an engine's
+// OrphanedRelationshipsRepairOperationName RepairOperation can share this
+// logic rather than reimplementing batched deletes.
+func DeleteOrphanedRelationshipsBatch(ctx context.Context, ds datastore.Datastore, orphans []OrphanedRelationship, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	_, err := ds.ReadWriteTransaction(ctx, func(_ context.Context, rwt datastore.ReadWriteTransaction) error {
+		for start := 0; start < len(orphans); start += batchSize {
+			end := start + batchSize
+			if end > len(orphans) {
+				end = len(orphans)
+			}
+			batch := orphans[start:end]
+
+			updates := make([]*core.RelationTupleUpdate, 0, len(batch))
+			for _, orphan := range batch {
+				updates = append(updates, &core.RelationTupleUpdate{
+					Operation: core.RelationTupleUpdate_DELETE,
+					Tuple: &core.RelationTuple{
+						ResourceAndRelation: &orphan.Resource,
+						Subject:             &orphan.Subject,
+					},
+				})
+			}
+
+			if err := rwt.WriteRelationships(ctx, updates); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	return err
+}
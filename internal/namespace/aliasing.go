@@ -3,45 +3,59 @@ package namespace
 import (
 	"fmt"
 	"sort"
+
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
 )
 
+// defaultMaxAliasChainLength is the default longest alias chain
+// computePermissionAliases accepts without a warning; chains longer than
+// this produce one. The computed map is always flattened to a single hop,
+// so ResolveAlias costs one map read however long the chain is, but a long
+// chain is usually a sign the schema could be simplified.
+const defaultMaxAliasChainLength = 8
+
+// aliasWarning describes a schema-compile-time observation about the
+// alias graph that doesn't block validation but may be worth surfacing to
+// the schema author.
+type aliasWarning struct {
+	Relation    string
+	ChainLength int
+}
+
+func (w aliasWarning) String() string {
+	return fmt.Sprintf("permission %q resolves through a chain of %d aliases; consider flattening it", w.Relation, w.ChainLength)
+}
+
 // computePermissionAliases computes a map of aliases between the various permissions in a
 // namespace. A permission is considered an alias if it *directly* refers to another permission
-// or relation without any other form of expression.
-func computePermissionAliases(typeSystem *ValidatedNamespaceTypeSystem) (map[string]string, error) {
+// or relation without any other form of expression, or if it is an intersection whose operands
+// are all aliases of that same target. Exclusions are never treated as aliases. Chains longer
+// than maxChainLength produce a warning (not an error) so schema authors can consider flattening
+// them.
+func computePermissionAliases(typeSystem *ValidatedNamespaceTypeSystem, maxChainLength int) (map[string]string, []aliasWarning, error) {
+	if maxChainLength <= 0 {
+		maxChainLength = defaultMaxAliasChainLength
+	}
+
 	aliases := map[string]string{}
 	done := map[string]struct{}{}
 	workingSet := map[string]string{}
 
 	for _, rel := range typeSystem.nsDef.Relation {
 		// Ensure the relation has a rewrite...
-		if rel.GetUsersetRewrite() == nil {
+		rewrite := rel.GetUsersetRewrite()
+		if rewrite == nil {
 			done[rel.Name] = struct{}{}
 			continue
 		}
 
-		// ... with a union ...
-		union := rel.GetUsersetRewrite().GetUnion()
-		if union == nil {
-			done[rel.Name] = struct{}{}
-			continue
-		}
-
-		// ... with a single child ...
-		if len(union.Child) != 1 {
-			done[rel.Name] = struct{}{}
-			continue
-		}
-
-		// ... that is a computed userset.
-		computedUserset := union.Child[0].GetComputedUserset()
-		if computedUserset == nil {
+		aliasedPermOrRel, ok := aliasTargetForRewrite(rel.Name, rewrite)
+		if !ok {
 			done[rel.Name] = struct{}{}
 			continue
 		}
 
 		// If the aliased item is a relation, then we've found the alias target.
-		aliasedPermOrRel := computedUserset.GetRelation()
 		if !typeSystem.IsPermission(aliasedPermOrRel) {
 			done[rel.Name] = struct{}{}
 			aliases[rel.Name] = aliasedPermOrRel
@@ -52,17 +66,34 @@ func computePermissionAliases(typeSystem *ValidatedNamespaceTypeSystem) (map[str
 		workingSet[rel.Name] = aliasedPermOrRel
 	}
 
+	chainLength := map[string]int{}
+	var warnings []aliasWarning
+
 	for len(workingSet) > 0 {
 		startingCount := len(workingSet)
 		for relName, aliasedPermission := range workingSet {
 			if _, ok := done[aliasedPermission]; ok {
 				done[relName] = struct{}{}
 
+				depth := 1
 				if alias, ok := aliases[aliasedPermission]; ok {
 					aliases[relName] = alias
+					// A permission aliasing a relation directly was resolved in
+					// the first loop and has no recorded length: it is one hop.
+					targetLength, recorded := chainLength[aliasedPermission]
+					if !recorded {
+						targetLength = 1
+					}
+					depth = targetLength + 1
 				} else {
 					aliases[relName] = aliasedPermission
 				}
+				chainLength[relName] = depth
+
+				if depth > maxChainLength {
+					warnings = append(warnings, aliasWarning{Relation: relName, ChainLength: depth})
+				}
+
 				delete(workingSet, relName)
 				continue
 			}
@@ -73,9 +104,152 @@ func computePermissionAliases(typeSystem *ValidatedNamespaceTypeSystem) (map[str
 				keys = append(keys, key)
 			}
 			sort.Strings(keys)
-			return nil, fmt.Errorf("there exists a cycle in permissions: %v", keys)
+			return nil, nil, fmt.Errorf("there exists a cycle in permissions: %v", keys)
 		}
 	}
 
-	return aliases, nil
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Relation < warnings[j].Relation })
+
+	return aliases, warnings, nil
+}
+
+// aliasTargetForRewrite returns the relation/permission that rewrite is a
+// pure alias of, if any. A rewrite is a pure alias if it is:
+//
+//   - a union with a single computed-userset child, or
+//   - an intersection in which every child is an alias of the same target T
+//     (a direct computed userset or a nested single-child union), so that
+//     the intersection evaluates to T.
+//
+// An exclusion is never a pure alias.
+func aliasTargetForRewrite(relationName string, rewrite *core.UsersetRewrite) (string, bool) {
+	if union := rewrite.GetUnion(); union != nil {
+		return aliasTargetForUnion(union)
+	}
+
+	if intersection := rewrite.GetIntersection(); intersection != nil {
+		return aliasTargetForNoOpWrappedChildren(relationName, intersection.Child)
+	}
+
+	if exclusion := rewrite.GetExclusion(); exclusion != nil {
+		// An exclusion can never be a pure alias, no matter what its
+		// operands look like: `base - base` evaluates to the empty set, not
+		// base, so treating the subtrahends as structural no-ops (the way
+		// intersection's other operands can be) is unsound -- it would
+		// make an intentionally-always-deny permission resolve as
+		// equivalent to base, silently granting access that should never
+		// be granted. There is no safe, general way to prove an exclusion
+		// is non-empty from its structure alone, so exclusions are simply
+		// never collapsed.
+		return "", false
+	}
+
+	return "", false
+}
+
+// aliasTargetForUnion returns the relation/permission a union is a pure
+// alias of: a union with exactly one child that is a direct computed
+// userset.
+func aliasTargetForUnion(union *core.SetOperation) (string, bool) {
+	if len(union.Child) != 1 {
+		return "", false
+	}
+
+	computedUserset := union.Child[0].GetComputedUserset()
+	if computedUserset == nil {
+		return "", false
+	}
+
+	return computedUserset.GetRelation(), true
+}
+
+// aliasTargetForNoOpWrappedChildren requires every child among children to
+// be an alias (either a direct computed userset, or a nested union with a
+// single computed userset child) of one and the same target other than
+// relationName, making the surrounding intersection a pass-through to it.
+func aliasTargetForNoOpWrappedChildren(relationName string, children []*core.SetOperation_Child) (string, bool) {
+	var target string
+	found := false
+
+	targets := make([]string, len(children))
+	for i, child := range children {
+		t, ok := childAliasTarget(child)
+		if !ok {
+			return "", false
+		}
+		targets[i] = t
+	}
+
+	for _, t := range targets {
+		if !found {
+			target = t
+			found = true
+			continue
+		}
+		if t != target {
+			return "", false
+		}
+	}
+
+	if !found || target == relationName {
+		return "", false
+	}
+
+	return target, true
+}
+
+// childAliasTarget returns the relation/permission a single set-operation
+// child is an alias of, whether it's a direct computed userset or a nested
+// union wrapping one.
+func childAliasTarget(child *core.SetOperation_Child) (string, bool) {
+	if computedUserset := child.GetComputedUserset(); computedUserset != nil {
+		return computedUserset.GetRelation(), true
+	}
+
+	if nested := child.GetUsersetRewrite(); nested != nil {
+		if union := nested.GetUnion(); union != nil {
+			return aliasTargetForUnion(union)
+		}
+	}
+
+	return "", false
+}
+
+// AliasIndex holds the flattened permission alias map computed for a single
+// namespace's type system by AttachAliases. Once computed, lookups via
+// ResolveAlias are a single map read rather than a walk of the full
+// rewrite. Its only caller is SchemaIndex.ResolveAlias, which forwards to
+// it; Check, Expand, and LookupResources dispatch do not consult an
+// AliasIndex, and SchemaIndex.CheckRelationship validates tuples against
+// raw relations/permissions without resolving aliases. The caller owns the
+// returned *AliasIndex
+// (typically alongside the type system it was computed from, e.g. as an
+// entry in SchemaIndex) -- nothing is retained globally, so there is
+// nothing to leak or evict.
+type AliasIndex struct {
+	aliases map[string]string
+}
+
+// AttachAliases computes the permission alias map for typeSystem and
+// returns it as an AliasIndex. It should be called once, immediately after
+// a namespace's type system has been validated.
+func AttachAliases(typeSystem *ValidatedNamespaceTypeSystem, maxChainLength int) (*AliasIndex, []aliasWarning, error) {
+	aliases, warnings, err := computePermissionAliases(typeSystem, maxChainLength)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &AliasIndex{aliases: aliases}, warnings, nil
+}
+
+// ResolveAlias returns the canonical relation/permission that permission is
+// a pure alias of, short-circuiting the need to evaluate permission's full
+// rewrite. It returns (_, false) if permission is not a known alias.
+func (idx *AliasIndex) ResolveAlias(permission string) (string, bool) {
+	if idx == nil {
+		return "", false
+	}
+
+	target, ok := idx.aliases[permission]
+	return target, ok
 }
@@ -0,0 +1,92 @@
+package namespace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+)
+
+func unionAlias(target string) *core.UsersetRewrite {
+	return &core.UsersetRewrite{
+		RewriteOperation: &core.UsersetRewrite_Union{
+			Union: &core.SetOperation{
+				Child: []*core.SetOperation_Child{
+					{ChildType: &core.SetOperation_Child_ComputedUserset{ComputedUserset: &core.ComputedUserset{Relation: target}}},
+				},
+			},
+		},
+	}
+}
+
+func intersectionOf(children ...*core.SetOperation_Child) *core.UsersetRewrite {
+	return &core.UsersetRewrite{
+		RewriteOperation: &core.UsersetRewrite_Intersection{
+			Intersection: &core.SetOperation{Child: children},
+		},
+	}
+}
+
+func exclusionOf(children ...*core.SetOperation_Child) *core.UsersetRewrite {
+	return &core.UsersetRewrite{
+		RewriteOperation: &core.UsersetRewrite_Exclusion{
+			Exclusion: &core.SetOperation{Child: children},
+		},
+	}
+}
+
+func computedChild(target string) *core.SetOperation_Child {
+	return &core.SetOperation_Child{ChildType: &core.SetOperation_Child_ComputedUserset{ComputedUserset: &core.ComputedUserset{Relation: target}}}
+}
+
+func TestAliasTargetForRewrite_UnionSingleChild(t *testing.T) {
+	target, ok := aliasTargetForRewrite("perm", unionAlias("view"))
+	require.True(t, ok)
+	require.Equal(t, "view", target)
+}
+
+func TestAliasTargetForRewrite_IntersectionOfMatchingAliasesCollapses(t *testing.T) {
+	rewrite := intersectionOf(computedChild("view"), computedChild("view"))
+	target, ok := aliasTargetForRewrite("perm", rewrite)
+	require.True(t, ok)
+	require.Equal(t, "view", target)
+}
+
+func TestAliasTargetForRewrite_IntersectionOfDifferingTargetsDoesNotCollapse(t *testing.T) {
+	rewrite := intersectionOf(computedChild("view"), computedChild("edit"))
+	_, ok := aliasTargetForRewrite("perm", rewrite)
+	require.False(t, ok)
+}
+
+func TestAliasTargetForRewrite_IntersectionReferencingItselfDoesNotCollapse(t *testing.T) {
+	rewrite := intersectionOf(computedChild("perm"), computedChild("perm"))
+	_, ok := aliasTargetForRewrite("perm", rewrite)
+	require.False(t, ok)
+}
+
+func TestAliasTargetForRewrite_ExclusionOfSameTargetDoesNotCollapse(t *testing.T) {
+	// perm = T - T always evaluates to the empty set, never to T, so this
+	// must never be treated as a pure alias of T.
+	rewrite := exclusionOf(computedChild("view"), computedChild("view"))
+	_, ok := aliasTargetForRewrite("perm", rewrite)
+	require.False(t, ok)
+}
+
+func TestAliasTargetForRewrite_ExclusionNeverCollapses(t *testing.T) {
+	rewrite := exclusionOf(computedChild("view"), computedChild("edit"))
+	_, ok := aliasTargetForRewrite("perm", rewrite)
+	require.False(t, ok)
+}
+
+func TestAliasTargetForRewrite_NestedUnionInsideIntersectionCollapses(t *testing.T) {
+	nested := &core.SetOperation_Child{
+		ChildType: &core.SetOperation_Child_UsersetRewrite{
+			UsersetRewrite: unionAlias("view"),
+		},
+	}
+	rewrite := intersectionOf(nested, computedChild("view"))
+	target, ok := aliasTargetForRewrite("perm", rewrite)
+	require.True(t, ok)
+	require.Equal(t, "view", target)
+}
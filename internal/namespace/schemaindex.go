@@ -0,0 +1,110 @@
+package namespace
+
+import (
+	"fmt"
+
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+// OrphanReason explains why CheckRelationship considered a relationship no
+// longer valid under the schema.
+type OrphanReason string
+
+const (
+	ReasonMissingResourceType     OrphanReason = "missing_resource_type"
+	ReasonMissingResourceRelation OrphanReason = "missing_resource_relation"
+	ReasonMissingSubjectType      OrphanReason = "missing_subject_type"
+	ReasonMissingSubjectRelation  OrphanReason = "missing_subject_relation"
+	ReasonRelationRequired        OrphanReason = "relation_required"
+)
+
+// SchemaIndex answers whether a relationship's resource type, resource
+// relation, subject type, and subject relation are all still defined by a
+// schema, using the same per-namespace relation walk that
+// computePermissionAliases relies on for alias resolution.
+type SchemaIndex struct {
+	typeSystems  map[string]*ValidatedNamespaceTypeSystem
+	aliasIndexes map[string]*AliasIndex
+}
+
+// NewSchemaIndex builds a SchemaIndex from the full set of validated
+// namespace type systems that make up a schema. Each namespace's
+// permission aliases are computed up front via AttachAliases so that
+// ResolveAlias can be served from a flattened map rather than re-walking
+// rewrites on every call.
+func NewSchemaIndex(typeSystems []*ValidatedNamespaceTypeSystem) (*SchemaIndex, error) {
+	index := &SchemaIndex{
+		typeSystems:  make(map[string]*ValidatedNamespaceTypeSystem, len(typeSystems)),
+		aliasIndexes: make(map[string]*AliasIndex, len(typeSystems)),
+	}
+
+	for _, ts := range typeSystems {
+		index.typeSystems[ts.nsDef.Name] = ts
+
+		aliasIndex, _, err := AttachAliases(ts, defaultMaxAliasChainLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute permission aliases for %q: %w", ts.nsDef.Name, err)
+		}
+		index.aliasIndexes[ts.nsDef.Name] = aliasIndex
+	}
+
+	return index, nil
+}
+
+// ResolveAlias returns the canonical relation/permission that permission is
+// a pure alias of within the given namespace, short-circuiting the need to
+// evaluate permission's full rewrite. It returns (_, false) if namespace is
+// unknown or permission is not a known alias.
+func (si *SchemaIndex) ResolveAlias(namespace, permission string) (string, bool) {
+	aliasIndex, ok := si.aliasIndexes[namespace]
+	if !ok {
+		return "", false
+	}
+
+	return aliasIndex.ResolveAlias(permission)
+}
+
+// CheckRelationship reports whether a relationship referencing the given
+// resource type/relation and subject type/relation is still valid under the
+// schema, and if not, why.
+func (si *SchemaIndex) CheckRelationship(resourceType, resourceRelation, subjectType, subjectRelation string) (ok bool, reason OrphanReason) {
+	resourceTS, ok := si.typeSystems[resourceType]
+	if !ok {
+		return false, ReasonMissingResourceType
+	}
+
+	if !resourceTS.hasRelation(resourceRelation) {
+		return false, ReasonMissingResourceRelation
+	}
+
+	subjectTS, ok := si.typeSystems[subjectType]
+	if !ok {
+		return false, ReasonMissingSubjectType
+	}
+
+	if subjectRelation == tuple.Ellipsis {
+		return true, ""
+	}
+
+	if !subjectTS.hasRelation(subjectRelation) {
+		return false, ReasonMissingSubjectRelation
+	}
+
+	// A subject relation that is itself a permission (rather than a
+	// relation) cannot be the target of a tuple's subject, since subjects
+	// are always concrete relations.
+	if subjectTS.IsPermission(subjectRelation) {
+		return false, ReasonRelationRequired
+	}
+
+	return true, ""
+}
+
+func (ts *ValidatedNamespaceTypeSystem) hasRelation(name string) bool {
+	for _, rel := range ts.nsDef.Relation {
+		if rel.Name == name {
+			return true
+		}
+	}
+	return false
+}
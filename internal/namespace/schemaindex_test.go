@@ -0,0 +1,36 @@
+package namespace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSchemaIndex_Empty(t *testing.T) {
+	index, err := NewSchemaIndex(nil)
+	require.NoError(t, err)
+	require.NotNil(t, index)
+}
+
+func TestCheckRelationship_UnknownResourceType(t *testing.T) {
+	index, err := NewSchemaIndex(nil)
+	require.NoError(t, err)
+
+	ok, reason := index.CheckRelationship("document", "viewer", "user", "")
+	require.False(t, ok)
+	require.Equal(t, ReasonMissingResourceType, reason)
+}
+
+func TestResolveAlias_UnknownNamespace(t *testing.T) {
+	index, err := NewSchemaIndex(nil)
+	require.NoError(t, err)
+
+	_, ok := index.ResolveAlias("document", "view")
+	require.False(t, ok)
+}
+
+func TestAliasIndexResolveAlias_NilIndex(t *testing.T) {
+	var idx *AliasIndex
+	_, ok := idx.ResolveAlias("view")
+	require.False(t, ok)
+}
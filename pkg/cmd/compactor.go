@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/authzed/spicedb/internal/datastore/common"
+	log "github.com/authzed/spicedb/internal/logging"
+	"github.com/authzed/spicedb/pkg/cmd/datastore"
+	"github.com/authzed/spicedb/pkg/cmd/server"
+	"github.com/authzed/spicedb/pkg/cmd/termination"
+	dspkg "github.com/authzed/spicedb/pkg/datastore"
+)
+
+// RegisterCompactorRootFlags mirrors RegisterDatastoreRootFlags and
+// registers no flags on the root command; NewCompactorCommand registers all
+// of the compactor's flags on the compactor command itself.
+func RegisterCompactorRootFlags(_ *cobra.Command) {
+}
+
+// compactorFlags holds the flags specific to the `compactor` command,
+// separate from the shared datastore.Config flags.
+type compactorFlags struct {
+	interval    time.Duration
+	window      time.Duration
+	timeout     time.Duration
+	leaseTTL    time.Duration
+	metricsAddr string
+}
+
+// NewCompactorCommand builds the standalone `spicedb compactor` command: a
+// dedicated long-running service that connects to the datastore, runs GC on
+// a fixed interval, and performs the deeper compaction passes the
+// in-process embedded GC skips. Unlike `datastore gc`, it is meant to be
+// deployed continuously (optionally with multiple replicas, coordinated via
+// a datastore-backed lease) rather than run as a one-shot job.
+func NewCompactorCommand(programName string) (*cobra.Command, error) {
+	cfg := datastore.Config{}
+
+	compactorCmd := &cobra.Command{
+		Use:     "compactor",
+		Short:   "runs the standalone garbage collection and compaction service",
+		Long:    "Connects to the configured datastore and continuously runs garbage collection and deeper compaction passes on a fixed interval",
+		PreRunE: server.DefaultPreRunE(programName),
+	}
+
+	if err := datastore.RegisterDatastoreFlagsWithPrefix(compactorCmd.Flags(), "", &cfg); err != nil {
+		return nil, err
+	}
+
+	flags := &compactorFlags{}
+	compactorCmd.Flags().DurationVar(&flags.interval, "compaction-interval", 1*time.Hour, "time between compaction passes")
+	compactorCmd.Flags().DurationVar(&flags.window, "gc-window", 24*time.Hour, "window of history to retain when garbage collecting")
+	compactorCmd.Flags().DurationVar(&flags.timeout, "compaction-timeout", 5*time.Minute, "time limit for a single compaction pass")
+	compactorCmd.Flags().DurationVar(&flags.leaseTTL, "lease-ttl", 30*time.Second, "duration a held compactor lease remains valid without renewal")
+	compactorCmd.Flags().StringVar(&flags.metricsAddr, "metrics-addr", ":9092", "address for the compactor's /metrics, /healthz, and /debug/pprof listener")
+
+	compactorCmd.RunE = termination.PublishError(func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		// The compactor drives its own GC loop; disable the in-process one.
+		cfg.GCInterval = -1 * time.Hour
+		cfg.RequestHedgingEnabled = false
+
+		ds, err := datastore.NewDatastore(ctx, cfg.ToOption())
+		if err != nil {
+			return fmt.Errorf("failed to create datastore: %w", err)
+		}
+
+		for {
+			wds, ok := ds.(dspkg.UnwrappableDatastore)
+			if !ok {
+				break
+			}
+			ds = wds.Unwrap()
+		}
+
+		compactor, ok := ds.(common.Compactor)
+		if !ok {
+			return fmt.Errorf("datastore of type %T does not support the compactor service", ds)
+		}
+
+		log.Ctx(ctx).Info().Str("metrics-addr", flags.metricsAddr).Msg("starting compactor service...")
+		return common.RunCompactor(ctx, compactor, common.CompactorConfig{
+			Interval:    flags.interval,
+			Window:      flags.window,
+			Timeout:     flags.timeout,
+			LeaseTTL:    flags.leaseTTL,
+			MetricsAddr: flags.metricsAddr,
+		})
+	})
+
+	return compactorCmd, nil
+}
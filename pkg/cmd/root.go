@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// NewRootCommand builds the top-level `spicedb` command tree, wiring in
+// every subcommand this package exposes so they're actually reachable by
+// operators rather than just constructible in tests.
+func NewRootCommand(programName string) (*cobra.Command, error) {
+	rootCmd := &cobra.Command{
+		Use:           programName,
+		Short:         "A modern permissions database",
+		Long:          "A database that stores, computes, and validates application permissions",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	RegisterDatastoreRootFlags(rootCmd)
+	datastoreCmd, err := NewDatastoreCommand(programName)
+	if err != nil {
+		return nil, err
+	}
+	rootCmd.AddCommand(datastoreCmd)
+
+	RegisterCompactorRootFlags(rootCmd)
+	compactorCmd, err := NewCompactorCommand(programName)
+	if err != nil {
+		return nil, err
+	}
+	rootCmd.AddCommand(compactorCmd)
+
+	return rootCmd, nil
+}